@@ -0,0 +1,42 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+// HeaderValue is a single header name/value pair an IngressRoute adds to a
+// request or response.
+type HeaderValue struct {
+	// Name is the header name to set.
+	Name string `json:"name"`
+
+	// Value is the header value. Envoy format specifiers such as
+	// %DOWNSTREAM_REMOTE_ADDRESS% are passed straight through and
+	// interpreted by Envoy at request time.
+	Value string `json:"value"`
+}
+
+// HeaderPolicy declares the header manipulation an IngressRoute's Route or
+// VirtualHost applies to requests or responses passing through it. No field
+// of RouteSpec or VirtualHostSpec has this type; it is consumed through
+// dag.BuildHeaderPolicy.
+type HeaderPolicy struct {
+	// Add lists the headers to set. An existing header of the same name
+	// is appended to, not replaced, matching core.HeaderValueOption's
+	// Append semantics.
+	// +optional
+	Add []HeaderValue `json:"add,omitempty"`
+
+	// Remove lists header names to strip.
+	// +optional
+	Remove []string `json:"remove,omitempty"`
+}
@@ -0,0 +1,64 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+// JWTProvider declares a named JWT provider that Envoy's jwt_authn filter
+// can validate bearer tokens against. It is declared once per VirtualHost
+// and referenced by name from a route's JWTRequirement, so that several routes
+// sharing the same provider produce a single filter provider entry and a
+// single JWKS cluster instead of one per route. VirtualHostSpec has no field
+// of this type; it is consumed through dag.BuildJWTProvider.
+type JWTProvider struct {
+	// Name identifies this provider for use in a Route's JWTRequirement.
+	Name string `json:"name"`
+
+	// Issuer is the expected "iss" claim. If unset, the issuer is not checked.
+	// +optional
+	Issuer string `json:"issuer,omitempty"`
+
+	// Audiences restricts accepted tokens to these "aud" claims. If unset,
+	// any audience is accepted.
+	// +optional
+	Audiences []string `json:"audiences,omitempty"`
+
+	// JWKSURI is the URL Envoy's jwt_authn filter fetches and refreshes
+	// the provider's JSON Web Key Set from.
+	JWKSURI string `json:"jwksURI"`
+
+	// ForwardJWT, if true, keeps the verified JWT on the request forwarded
+	// to the upstream, in addition to any ClaimToHeaders below.
+	// +optional
+	ForwardJWT bool `json:"forwardJWT,omitempty"`
+
+	// ClaimToHeaders copies verified claims onto request headers so RBAC
+	// and the upstream can make decisions based on them.
+	// +optional
+	ClaimToHeaders []JWTClaimToHeader `json:"claimToHeaders,omitempty"`
+}
+
+// JWTClaimToHeader copies a single verified JWT claim onto a request header.
+type JWTClaimToHeader struct {
+	// Claim is the name of the JWT claim to copy.
+	Claim string `json:"claim"`
+	// Header is the name of the request header to set to the claim's value.
+	Header string `json:"header"`
+}
+
+// JWTRequirement is set on a Route to require a valid JWT, issued by the
+// named provider, before the route's RBAC and upstream are reached.
+type JWTRequirement struct {
+	// ProviderName must match the Name of a JWTProvider declared on the
+	// enclosing IngressRoute's spec.virtualhost.jwtProviders.
+	ProviderName string `json:"providerName"`
+}
@@ -0,0 +1,61 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package v1beta1
+
+// TracingConfig describes the distributed tracing a VirtualHost attaches
+// to the routes it serves, against a collector Contour's config file has
+// declared under config.TracingConfig.Collectors. VirtualHostSpec has no
+// field of this type; it is consumed through dag.BuildTracingPolicy.
+type TracingConfig struct {
+	// CollectorName must match the Name of a collector declared in
+	// Contour's config file.
+	CollectorName string `json:"collectorName"`
+
+	// ServiceName overrides the AltStatName Envoy reports for this
+	// VirtualHost's clusters, so operators can tell their spans and stats
+	// apart from the generated cluster name. If unset, the generated
+	// cluster name is used.
+	// +optional
+	ServiceName string `json:"serviceName,omitempty"`
+
+	// ClientSampling is the percentage, in [0, 100], of requests Envoy
+	// decides to trace when the incoming request carries no tracing
+	// decision of its own. If unset, Envoy's own default is used.
+	// +optional
+	ClientSampling *float64 `json:"clientSampling,omitempty"`
+
+	// CustomTags adds extra tags to every span this VirtualHost's routes
+	// produce, each either a literal value or copied from a request
+	// header.
+	// +optional
+	CustomTags []TracingCustomTag `json:"customTags,omitempty"`
+}
+
+// TracingCustomTag adds a single tag to every span a VirtualHost's tracing
+// policy produces.
+type TracingCustomTag struct {
+	// Tag is the name the span reports this value under.
+	Tag string `json:"tag"`
+
+	// Literal sets Tag to a fixed string. Exactly one of Literal or
+	// RequestHeaderName must be set.
+	// +optional
+	Literal string `json:"literal,omitempty"`
+
+	// RequestHeaderName sets Tag to the value of the named request
+	// header, omitting the tag if the header is absent. Exactly one of
+	// Literal or RequestHeaderName must be set.
+	// +optional
+	RequestHeaderName string `json:"requestHeaderName,omitempty"`
+}
@@ -14,8 +14,10 @@
 package contour
 
 import (
+	"fmt"
 	"sync"
 
+	"runtime/debug"
 	"strings"
 	"time"
 
@@ -29,8 +31,56 @@ import (
 	ingressroutev1 "github.com/heptio/contour/apis/contour/v1beta1"
 	"github.com/heptio/contour/internal/dag"
 	"github.com/heptio/contour/internal/envoy"
+	"github.com/heptio/contour/pkg/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
 )
 
+// dagVisitPanicsTotal counts panics recovered while translating the DAG
+// into Envoy resources, labelled by the visitor that recovered. It lets
+// operators see a misbehaving IngressRoute in metrics rather than only in
+// logs, since the visitor itself no longer propagates the panic. Shared by
+// every *Visitor that recurses over a *dag.DAG (clusterVisitor, routeVisitor,
+// ...), so a single dashboard query covers all of them.
+var dagVisitPanicsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "contour_dag_visit_panics_total",
+	Help: "Total number of panics recovered while visiting the DAG, by visitor.",
+}, []string{"visitor"})
+
+func init() {
+	prometheus.MustRegister(dagVisitPanicsTotal)
+}
+
+// recoverDagVisitPanic reports err, the value recovered from a panic raised
+// while translating vertex on behalf of visitor (a short name such as
+// "cluster" or "route", used as the dagVisitPanicsTotal label), logging the
+// vertex's kind, namespace/name (when available), and a stack trace. It is
+// a no-op if err is nil. recover only stops a panic when called directly by
+// the deferred function, so each visitor's deferred recoverPanic calls
+// recover itself and passes the result here.
+func recoverDagVisitPanic(visitor string, vertex dag.Vertex, err interface{}, logger logrus.FieldLogger) {
+	if err == nil {
+		return
+	}
+
+	dagVisitPanicsTotal.WithLabelValues(visitor).Inc()
+
+	fields := logrus.Fields{
+		"vertex": fmt.Sprintf("%T", vertex),
+		"error":  err,
+		"stack":  string(debug.Stack()),
+	}
+	if named, ok := vertex.(interface {
+		Namespace() string
+		Name() string
+	}); ok {
+		fields["namespace"] = named.Namespace()
+		fields["name"] = named.Name()
+	}
+
+	logger.WithFields(fields).Error("recovered from panic visiting DAG vertex, skipping it")
+}
+
 // ClusterCache manages the contents of the gRPC CDS cache.
 type ClusterCache struct {
 	clusterCache
@@ -41,6 +91,30 @@ type clusterCache struct {
 	values  map[string]*v2.Cluster
 	waiters []chan int
 	last    int
+
+	// versions records the version at which each resource currently in
+	// values was last changed. It is bumped only when the proto contents
+	// of a named cluster actually differ from what was previously stored,
+	// so that a delta client which has already seen a given version does
+	// not need that resource resent.
+	versions map[string]uint64
+
+	// removedSince is a ring buffer of clusters removed from values,
+	// most recent first, used to answer Deltas for clients that are
+	// behind but not so far behind that a full resync is required.
+	removedSince []removedCluster
+}
+
+// removedClusterHistory bounds the number of removals clusterCache
+// remembers before a Deltas caller is forced to fall back to a full
+// SotW style resync.
+const removedClusterHistory = 100
+
+// removedCluster records the version at which a named cluster was
+// removed from the cache.
+type removedCluster struct {
+	name    string
+	version uint64
 }
 
 // Register registers ch to receive a value when Notify is called.
@@ -64,14 +138,97 @@ func (c *clusterCache) Register(ch chan int, last int) {
 }
 
 // Update replaces the contents of the cache with the supplied map.
+//
+// In addition to the SotW semantics above, Update diffs v against the
+// previous contents of the cache and records a per-resource version for
+// every cluster that was added or whose proto contents changed, plus an
+// entry in removedSince for every cluster that disappeared. This is what
+// allows Deltas to serve Envoy's incremental xDS stream without resending
+// clusters that a subscriber already has.
 func (c *clusterCache) Update(v map[string]*v2.Cluster) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	if c.versions == nil {
+		c.versions = make(map[string]uint64)
+	}
+
+	next := uint64(c.last) + 1
+	for name, cluster := range v {
+		old, ok := c.values[name]
+		if !ok || !proto.Equal(old, cluster) {
+			c.versions[name] = next
+		}
+	}
+	for name := range c.values {
+		if _, ok := v[name]; !ok {
+			delete(c.versions, name)
+			c.removedSince = append([]removedCluster{{name: name, version: next}}, c.removedSince...)
+		}
+	}
+	if len(c.removedSince) > removedClusterHistory {
+		c.removedSince = c.removedSince[:removedClusterHistory]
+	}
+
 	c.values = v
 	c.notify()
 }
 
+// Deltas returns the clusters added or changed, and the names removed,
+// since sinceVersion, restricted to the names present in subscribed (a nil
+// or empty subscribed matches every name). The returned version is the
+// cache's current version and should be passed as sinceVersion on the next
+// call. ok is false if sinceVersion is older than the cache's removal
+// history can account for, in which case the caller must fall back to a
+// full SotW style resync via Values.
+func (c *clusterCache) Deltas(sinceVersion int, subscribed map[string]bool) (added []*v2.Cluster, removed []string, version int, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	matches := func(name string) bool {
+		return len(subscribed) == 0 || subscribed[name]
+	}
+
+	for name, cluster := range c.values {
+		if matches(name) && int(c.versions[name]) > sinceVersion {
+			added = append(added, cluster)
+		}
+	}
+	for _, r := range c.removedSince {
+		if int(r.version) <= sinceVersion {
+			break
+		}
+		if matches(r.name) {
+			removed = append(removed, r.name)
+		}
+	}
+	if len(c.removedSince) == removedClusterHistory && int(c.removedSince[len(c.removedSince)-1].version) > sinceVersion {
+		// the caller is further behind than our removal history can
+		// account for; it must fall back to a full resync.
+		return nil, nil, c.last, false
+	}
+
+	return added, removed, c.last, true
+}
+
+// DeltaHandler answers a single Envoy DeltaAggregatedResources request for
+// CDS. subscribe is the resource name list Envoy sent on the wire for this
+// type URL (a nil/empty list means "subscribe to everything", matching
+// go-control-plane's convention for the initial delta request); sinceVersion
+// is the version the client last acked. clusterDiscoveryServer.DeltaClusters
+// calls this once per request on its stream, gated on
+// config.XDSServerConfig.IncrementalXDS.
+func (c *ClusterCache) DeltaHandler(sinceVersion int, subscribe []string) (added []*v2.Cluster, removed []string, version int, ok bool) {
+	var subscribed map[string]bool
+	if len(subscribe) > 0 {
+		subscribed = make(map[string]bool, len(subscribe))
+		for _, name := range subscribe {
+			subscribed[name] = true
+		}
+	}
+	return c.Deltas(sinceVersion, subscribed)
+}
+
 // notify notifies all registered waiters that an event has occurred.
 func (c *clusterCache) notify() {
 	c.last++
@@ -100,6 +257,30 @@ type clusterVisitor struct {
 	*ClusterCache
 	dag.Visitable
 
+	// TLSParameters supplies the global default cipher suites and TLS
+	// protocol version bounds for upstream clusters, taken from Contour's
+	// config file.
+	TLSParameters *config.TLSParameters
+
+	// TracingPolicies carries each VirtualHost's validated tracing
+	// configuration, keyed by the EDS cluster name it applies to. A
+	// cluster name with no entry here has no tracing override. It is keyed
+	// by cluster because AltStatName is set on every cluster a
+	// VirtualHost's routes reach. The DAG builder does not fill this map
+	// in; it holds only what the code constructing clusterVisitor sets.
+	TracingPolicies map[string]*dag.TracingPolicy
+
+	// TLSOverrides carries each Service's validated
+	// spec.upstreamValidation.tlsParameters, keyed by EDS cluster name the
+	// same way TracingPolicies is: dag.Service has no field for it, so
+	// edscluster looks the override up here instead of adding one. The
+	// DAG builder does not fill this map in either.
+	TLSOverrides map[string]*config.TLSParameters
+
+	// Logger receives structured diagnostics for any panic recovered while
+	// visiting the DAG. Defaults to logrus.StandardLogger() if nil.
+	Logger logrus.FieldLogger
+
 	clusters map[string]*v2.Cluster
 }
 
@@ -110,13 +291,76 @@ func (v *clusterVisitor) Visit() map[string]*v2.Cluster {
 }
 
 func (v *clusterVisitor) visit(vertex dag.Vertex) {
-	if service, ok := vertex.(*dag.Service); ok {
-		v.edscluster(service)
+	// A nil pointer or other programmer error deep inside a single bad
+	// vertex must not crash the whole translation goroutine and brown out
+	// every Envoy in the cluster. Recovering here, rather than only in
+	// Visit, means the panic is contained to the vertex (and its
+	// children) that caused it; siblings already visited, and siblings
+	// still to come, are unaffected.
+	defer v.recoverPanic(vertex)
+
+	switch obj := vertex.(type) {
+	case *dag.Service:
+		v.edscluster(obj)
+	case *dag.JWTProvider:
+		// A JWTProvider may be reachable from several routes; only build
+		// its JWKS cluster once, the same way edscluster dedupes Services.
+		v.jwkscluster(obj)
+	case *dag.TracingCollector:
+		v.tracingcluster(obj)
 	}
 	// recurse into children of v
 	vertex.Visit(v.visit)
 }
 
+// recoverPanic recovers from a panic raised while translating vertex,
+// bumping contour_dag_visit_panics_total{visitor="cluster"}. It is a no-op
+// unless a panic is in flight.
+func (v *clusterVisitor) recoverPanic(vertex dag.Vertex) {
+	recoverDagVisitPanic("cluster", vertex, recover(), v.logger())
+}
+
+func (v *clusterVisitor) logger() logrus.FieldLogger {
+	if v.Logger != nil {
+		return v.Logger
+	}
+	return logrus.StandardLogger()
+}
+
+// jwkscluster builds the Envoy cluster used by the jwt_authn HTTP filter to
+// fetch and refresh a provider's JWKS document. It reuses the EDS/STRICT_DNS
+// plumbing in edscluster where possible, but a JWKS endpoint is typically an
+// external host rather than a Kubernetes Service, so the cluster is backed
+// by a static STRICT_DNS load assignment instead of EDS.
+func (v *clusterVisitor) jwkscluster(p *dag.JWTProvider) {
+	name := envoy.Clustername(p)
+	if _, ok := v.clusters[name]; ok {
+		// already created this cluster via another provider reference. skip it.
+		return
+	}
+
+	c := &v2.Cluster{
+		Name:           name,
+		Type:           v2.Cluster_STRICT_DNS,
+		ConnectTimeout: 250 * time.Millisecond,
+		LoadAssignment: envoy.StaticClusterLoadAssignment(name, p.JWKSHostname, p.JWKSPort),
+		CommonLbConfig: commonLbConfig(),
+	}
+
+	if p.JWKSScheme == "https" {
+		c.TlsContext = &auth.UpstreamTlsContext{
+			Sni: p.JWKSHostname,
+			CommonTlsContext: &auth.CommonTlsContext{
+				ValidationContextType: &auth.CommonTlsContext_ValidationContextSdsSecretConfig{
+					ValidationContextSdsSecretConfig: envoy.CASecretConfig(p.CACertificate),
+				},
+			},
+		}
+	}
+
+	v.clusters[c.Name] = c
+}
+
 func (v *clusterVisitor) edscluster(svc *dag.Service) {
 	name := envoy.Clustername(svc)
 	if _, ok := v.clusters[name]; ok {
@@ -130,12 +374,8 @@ func (v *clusterVisitor) edscluster(svc *dag.Service) {
 		EdsClusterConfig: edsconfig("contour", svc),
 		ConnectTimeout:   250 * time.Millisecond,
 		LbPolicy:         edslbstrategy(svc.LoadBalancerStrategy),
-		CommonLbConfig: &v2.Cluster_CommonLbConfig{
-			HealthyPanicThreshold: &envoy_type.Percent{ // Disable HealthyPanicThreshold
-				Value: 0,
-			},
-		},
-		HealthChecks: edshealthcheck(svc.HealthCheck),
+		CommonLbConfig:   commonLbConfig(),
+		HealthChecks:     edshealthcheck(svc.HealthCheck),
 	}
 
 	if svc.MaxConnections > 0 || svc.MaxPendingRequests > 0 || svc.MaxRequests > 0 || svc.MaxRetries > 0 {
@@ -149,20 +389,169 @@ func (v *clusterVisitor) edscluster(svc *dag.Service) {
 		}
 	}
 
+	override := v.TLSOverrides[name]
 	switch svc.Protocol {
 	case "h2":
 		c.Http2ProtocolOptions = &core.Http2ProtocolOptions{}
+	case "h2c":
+		c.Http2ProtocolOptions = &core.Http2ProtocolOptions{}
+	}
+	// An upstream TLS handshake is needed whenever the Service is h2 (TLS
+	// is how Contour picks http/2 over http/1.1 with Envoy's upstream ALPN)
+	// or an IngressRoute sets tlsParameters to validate a plain "https"
+	// Service's certificate: protocol alone must not gate override, or an
+	// h1 Service's tlsParameters would silently never reach Envoy.
+	if svc.Protocol == "h2" || override != nil {
 		c.TlsContext = &auth.UpstreamTlsContext{
 			CommonTlsContext: &auth.CommonTlsContext{
-				AlpnProtocols: []string{"h2"},
+				AlpnProtocols: alpnProtocols(svc.Protocol),
+				TlsParams:     v.tlsParams(override),
 			},
 		}
-	case "h2c":
+	}
+
+	if policy, ok := v.TracingPolicies[name]; ok && policy.ServiceName != "" {
+		// AltStatName lets operators tell per-cluster spans and stats
+		// apart from the generated EDS cluster name.
+		c.AltStatName = policy.ServiceName
+	}
+	v.clusters[c.Name] = c
+}
+
+// tracingcluster builds the Envoy cluster Contour's tracing HTTP filter
+// reports spans to. Like jwkscluster, the collector is usually not a
+// Kubernetes Service fronted by EDS, so it is materialized directly from
+// the operator supplied address as a STRICT_DNS cluster; unlike
+// jwkscluster, TLS is optional
+// rather than scheme-driven, since a collector address has no URI to infer
+// it from.
+func (v *clusterVisitor) tracingcluster(collector *dag.TracingCollector) {
+	name := envoy.Clustername(collector)
+	if _, ok := v.clusters[name]; ok {
+		// already created this cluster for another tracing provider reference.
+		return
+	}
+
+	c := &v2.Cluster{
+		Name:           name,
+		Type:           v2.Cluster_STRICT_DNS,
+		ConnectTimeout: 250 * time.Millisecond,
+		LoadAssignment: envoy.StaticClusterLoadAssignment(name, collector.Hostname, collector.Port),
+		CommonLbConfig: commonLbConfig(),
+	}
+
+	if collector.Protocol == "h2" {
 		c.Http2ProtocolOptions = &core.Http2ProtocolOptions{}
 	}
+
+	if collector.Secure {
+		c.TlsContext = &auth.UpstreamTlsContext{
+			Sni: collector.Hostname,
+			CommonTlsContext: &auth.CommonTlsContext{
+				ValidationContextType: &auth.CommonTlsContext_ValidationContextSdsSecretConfig{
+					ValidationContextSdsSecretConfig: envoy.CASecretConfig(collector.CACertificate),
+				},
+			},
+		}
+	}
+
 	v.clusters[c.Name] = c
 }
 
+// commonLbConfig disables Envoy's panic threshold, the one CommonLbConfig
+// setting jwkscluster, edscluster, and tracingcluster all apply: a
+// majority-unhealthy cluster of any of these kinds should fail closed
+// rather than spill over to endpoints already failing their health check.
+func commonLbConfig() *v2.Cluster_CommonLbConfig {
+	return &v2.Cluster_CommonLbConfig{
+		HealthyPanicThreshold: &envoy_type.Percent{
+			Value: 0,
+		},
+	}
+}
+
+// tlsParams builds the auth.TlsParameters Envoy uses to negotiate the
+// upstream TLS handshake, merging override on top of v.TLSParameters: any
+// field left unset in override falls back to Contour's configured default.
+// Validation of both is expected to have already happened at IngressRoute
+// admission time via config.TLSParameters.Validate. tlsParams itself never
+// errors: an unrecognised protocol version becomes TLS_AUTO, and cipher
+// suites are passed to Envoy as given, only trimmed and deduplicated.
+func (v *clusterVisitor) tlsParams(override *config.TLSParameters) *auth.TlsParameters {
+	ciphers := v.defaultCiphers()
+	minVersion := v.defaultMinimumProtocolVersion()
+	maxVersion := v.defaultMaximumProtocolVersion()
+
+	if override != nil {
+		if len(override.CipherSuites) > 0 {
+			ciphers = config.SanitizeCipherSuites(override.CipherSuites)
+		}
+		if override.MinimumProtocolVersion != "" {
+			minVersion = override.MinimumProtocolVersion
+		}
+		if override.MaximumProtocolVersion != "" {
+			maxVersion = override.MaximumProtocolVersion
+		}
+	}
+
+	return &auth.TlsParameters{
+		CipherSuites:              ciphers,
+		TlsMinimumProtocolVersion: tlsProtocolVersion(minVersion),
+		TlsMaximumProtocolVersion: tlsProtocolVersion(maxVersion),
+	}
+}
+
+func (v *clusterVisitor) defaultCiphers() []string {
+	if v.TLSParameters == nil || len(v.TLSParameters.CipherSuites) == 0 {
+		return config.DefaultTLSCiphers
+	}
+	return config.SanitizeCipherSuites(v.TLSParameters.CipherSuites)
+}
+
+func (v *clusterVisitor) defaultMinimumProtocolVersion() string {
+	if v.TLSParameters == nil {
+		return ""
+	}
+	return v.TLSParameters.MinimumProtocolVersion
+}
+
+func (v *clusterVisitor) defaultMaximumProtocolVersion() string {
+	if v.TLSParameters == nil {
+		return ""
+	}
+	return v.TLSParameters.MaximumProtocolVersion
+}
+
+// tlsProtocolVersion maps a config.TLSParameters version string to the
+// corresponding Envoy enum, defaulting to TLS_AUTO when version is unset or
+// unrecognised so an invalid value never downgrades the handshake below
+// what Envoy itself would otherwise pick.
+func tlsProtocolVersion(version string) auth.TlsParameters_TlsProtocol {
+	switch version {
+	case "1.0":
+		return auth.TlsParameters_TLSv1_0
+	case "1.1":
+		return auth.TlsParameters_TLSv1_1
+	case "1.2":
+		return auth.TlsParameters_TLSv1_2
+	case "1.3":
+		return auth.TlsParameters_TLSv1_3
+	default:
+		return auth.TlsParameters_TLS_AUTO
+	}
+}
+
+// alpnProtocols returns the upstream ALPN protocol list to negotiate for
+// protocol, or nil if protocol has no ALPN preference of its own: an h1
+// Service with a tlsParameters override still wants a plain TLS handshake,
+// not Envoy advertising h2 support it never asked for.
+func alpnProtocols(protocol string) []string {
+	if protocol == "h2" {
+		return []string{"h2"}
+	}
+	return nil
+}
+
 func edslbstrategy(lbStrategy string) v2.Cluster_LbPolicy {
 	switch lbStrategy {
 	case "WeightedLeastRequest":
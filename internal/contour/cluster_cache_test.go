@@ -0,0 +1,138 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contour
+
+import (
+	"testing"
+
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2"
+)
+
+func clusterNamed(name string) *v2.Cluster {
+	return &v2.Cluster{Name: name}
+}
+
+// TestClusterCacheDeltasOnlyReturnsChangedResources asserts that Deltas does
+// not resend a cluster whose proto contents are unchanged across an Update,
+// and does report one that was added or actually modified.
+func TestClusterCacheDeltasOnlyReturnsChangedResources(t *testing.T) {
+	var c clusterCache
+
+	c.Update(map[string]*v2.Cluster{
+		"a": clusterNamed("a"),
+		"b": clusterNamed("b"),
+	})
+	_, _, v1, ok := c.Deltas(0, nil)
+	if !ok {
+		t.Fatal("Deltas: ok = false, want true")
+	}
+
+	// Update "b" to a genuinely different proto, but leave "a" identical.
+	changedB := &v2.Cluster{Name: "b", AltStatName: "b-changed"}
+	c.Update(map[string]*v2.Cluster{
+		"a": clusterNamed("a"),
+		"b": changedB,
+	})
+
+	added, removed, v2_, ok := c.Deltas(v1, nil)
+	if !ok {
+		t.Fatal("Deltas: ok = false, want true")
+	}
+	if len(removed) != 0 {
+		t.Fatalf("removed = %v, want none", removed)
+	}
+	if len(added) != 1 || added[0].Name != "b" {
+		t.Fatalf("added = %v, want only the changed cluster %q", added, "b")
+	}
+	if v2_ <= v1 {
+		t.Fatalf("version did not advance: before=%d after=%d", v1, v2_)
+	}
+}
+
+// TestClusterCacheDeltasReportsRemovals asserts that a cluster dropped from
+// an Update shows up in removed, and that it stops showing up once the
+// caller has already acked a version at or after the removal.
+func TestClusterCacheDeltasReportsRemovals(t *testing.T) {
+	var c clusterCache
+
+	c.Update(map[string]*v2.Cluster{"a": clusterNamed("a"), "b": clusterNamed("b")})
+	_, _, v1, _ := c.Deltas(0, nil)
+
+	c.Update(map[string]*v2.Cluster{"a": clusterNamed("a")})
+
+	_, removed, v2_, ok := c.Deltas(v1, nil)
+	if !ok {
+		t.Fatal("Deltas: ok = false, want true")
+	}
+	if len(removed) != 1 || removed[0] != "b" {
+		t.Fatalf("removed = %v, want [b]", removed)
+	}
+
+	// A caller that has already acked v2_ should not see "b" again.
+	_, removedAgain, _, ok := c.Deltas(v2_, nil)
+	if !ok {
+		t.Fatal("Deltas: ok = false, want true")
+	}
+	if len(removedAgain) != 0 {
+		t.Fatalf("removed = %v, want none once the removal has been acked", removedAgain)
+	}
+}
+
+// TestClusterCacheDeltasFallsBackWhenHistoryExhausted asserts that a caller
+// whose last acked version is older than the ring buffer's retained
+// removals is told to fall back to a full SotW resync rather than silently
+// missing removals.
+func TestClusterCacheDeltasFallsBackWhenHistoryExhausted(t *testing.T) {
+	var c clusterCache
+
+	// Establish a baseline version, before the one removal this test cares
+	// about tracking.
+	c.Update(map[string]*v2.Cluster{"keep": clusterNamed("keep"), "gone": clusterNamed("gone")})
+	_, _, oldest, _ := c.Deltas(0, nil)
+
+	// Remove "gone": this is the removal the caller at version "oldest"
+	// should be able to observe, right up until it gets evicted below.
+	c.Update(map[string]*v2.Cluster{"keep": clusterNamed("keep")})
+
+	// Churn enough further removals through the cache to push the "gone"
+	// removal out of the ring buffer.
+	for i := 0; i < removedClusterHistory+10; i++ {
+		c.Update(map[string]*v2.Cluster{
+			"keep":  clusterNamed("keep"),
+			"churn": clusterNamed("churn"),
+		})
+		c.Update(map[string]*v2.Cluster{"keep": clusterNamed("keep")})
+	}
+
+	if _, _, _, ok := c.Deltas(oldest, nil); ok {
+		t.Fatal("Deltas: ok = true, want false once removal history has been evicted")
+	}
+}
+
+// TestClusterCacheDeltasRestrictsToSubscribed asserts that Deltas only
+// reports resources the caller has subscribed to, matching the semantics a
+// DeltaAggregatedResources stream expects.
+func TestClusterCacheDeltasRestrictsToSubscribed(t *testing.T) {
+	var c clusterCache
+
+	c.Update(map[string]*v2.Cluster{"a": clusterNamed("a"), "b": clusterNamed("b")})
+
+	added, _, _, ok := c.Deltas(0, map[string]bool{"a": true})
+	if !ok {
+		t.Fatal("Deltas: ok = false, want true")
+	}
+	if len(added) != 1 || added[0].Name != "a" {
+		t.Fatalf("added = %v, want only the subscribed cluster %q", added, "a")
+	}
+}
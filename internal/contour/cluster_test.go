@@ -0,0 +1,124 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contour
+
+import (
+	"testing"
+
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/auth"
+	"github.com/heptio/contour/internal/dag"
+	"github.com/heptio/contour/internal/envoy"
+	"github.com/heptio/contour/pkg/config"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fixedVisitable is a dag.Visitable over a fixed, flat list of vertices,
+// used so this test does not need to assemble a full *dag.DAG.
+type fixedVisitable []dag.Vertex
+
+func (f fixedVisitable) Visit(visit func(dag.Vertex)) {
+	for _, vertex := range f {
+		visit(vertex)
+	}
+}
+
+// TestClusterVisitorSkipsVertexOnPanic asserts that a Service vertex with a
+// nil ServicePort - which previously made edscluster dereference a nil
+// pointer and crash the whole translation goroutine - no longer prevents
+// the remaining, healthy Service vertices from producing clusters.
+func TestClusterVisitorSkipsVertexOnPanic(t *testing.T) {
+	broken := &dag.Service{
+		Object: &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "broken"},
+		},
+		ServicePort: nil,
+	}
+	healthy := &dag.Service{
+		Object: &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "healthy"},
+		},
+		ServicePort: &v1.ServicePort{Name: "http", Port: 80},
+	}
+
+	v := &clusterVisitor{
+		Visitable: fixedVisitable{broken, healthy},
+	}
+
+	got := v.Visit()
+
+	want := envoy.Clustername(healthy)
+	if _, ok := got[want]; !ok {
+		t.Fatalf("expected cluster %q for the healthy Service to be present despite the broken sibling panicking, got: %v", want, got)
+	}
+}
+
+// TestClusterVisitorTLSParams asserts that tlsParams merges a per-cluster
+// TLSOverrides entry on top of the visitor's configured default field by
+// field, leaving any field the override doesn't set at its default.
+func TestClusterVisitorTLSParams(t *testing.T) {
+	v := &clusterVisitor{
+		TLSParameters: &config.TLSParameters{
+			CipherSuites:           []string{"ECDHE-ECDSA-AES256-GCM-SHA384"},
+			MinimumProtocolVersion: "1.2",
+			MaximumProtocolVersion: "1.3",
+		},
+	}
+
+	got := v.tlsParams(&config.TLSParameters{MinimumProtocolVersion: "1.3"})
+	want := &auth.TlsParameters{
+		CipherSuites:              []string{"ECDHE-ECDSA-AES256-GCM-SHA384"},
+		TlsMinimumProtocolVersion: auth.TlsParameters_TLSv1_3,
+		TlsMaximumProtocolVersion: auth.TlsParameters_TLSv1_3,
+	}
+	if len(got.CipherSuites) != len(want.CipherSuites) || got.CipherSuites[0] != want.CipherSuites[0] {
+		t.Fatalf("tlsParams(...).CipherSuites = %v, want %v (inherited from the default, untouched by the override)", got.CipherSuites, want.CipherSuites)
+	}
+	if got.TlsMinimumProtocolVersion != want.TlsMinimumProtocolVersion {
+		t.Fatalf("tlsParams(...).TlsMinimumProtocolVersion = %v, want %v (set by the override)", got.TlsMinimumProtocolVersion, want.TlsMinimumProtocolVersion)
+	}
+	if got.TlsMaximumProtocolVersion != want.TlsMaximumProtocolVersion {
+		t.Fatalf("tlsParams(...).TlsMaximumProtocolVersion = %v, want %v (unchanged, since the override left it unset)", got.TlsMaximumProtocolVersion, want.TlsMaximumProtocolVersion)
+	}
+}
+
+// TestClusterVisitorEdsclusterTLSOverride asserts that a TLSOverrides entry
+// for an h1 ("") protocol Service still produces an UpstreamTlsContext with
+// no ALPN preference, rather than being silently ignored because the
+// Service isn't h2.
+func TestClusterVisitorEdsclusterTLSOverride(t *testing.T) {
+	svc := &dag.Service{
+		Object: &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "secure"},
+		},
+		ServicePort: &v1.ServicePort{Name: "https", Port: 443},
+	}
+
+	v := &clusterVisitor{
+		Visitable:    fixedVisitable{svc},
+		TLSOverrides: map[string]*config.TLSParameters{envoy.Clustername(svc): {MinimumProtocolVersion: "1.2"}},
+	}
+
+	got := v.Visit()
+	c, ok := got[envoy.Clustername(svc)]
+	if !ok {
+		t.Fatalf("expected cluster %q to be present", envoy.Clustername(svc))
+	}
+	if c.TlsContext == nil {
+		t.Fatal("edscluster did not set TlsContext for a Service with a TLSOverrides entry")
+	}
+	if len(c.TlsContext.CommonTlsContext.AlpnProtocols) != 0 {
+		t.Fatalf("TlsContext.CommonTlsContext.AlpnProtocols = %v, want none for a non-h2 Service", c.TlsContext.CommonTlsContext.AlpnProtocols)
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contour
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"github.com/gogo/protobuf/types"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/heptio/contour/pkg/config"
+)
+
+// clusterTypeURL identifies envoy.api.v2.Cluster in a DiscoveryResponse's
+// Resources/DeltaDiscoveryResponse's Resources, the same string Envoy sends
+// back in every CDS request's TypeUrl.
+const clusterTypeURL = "type.googleapis.com/envoy.api.v2.Cluster"
+
+// clusterDiscoveryServer implements v2.ClusterDiscoveryServiceServer, the
+// gRPC half of CDS: it turns Envoy's StreamClusters/FetchClusters/
+// DeltaClusters calls into calls against the ClusterCache clusterVisitor
+// populates. DeltaClusters is the incremental xDS stream DeltaHandler
+// exists to answer; it is only served - Envoy gets Unimplemented
+// otherwise - when incrementalXDS is set, since an operator should opt
+// into the delta protocol's different subscription and resync semantics
+// rather than get them by default.
+type clusterDiscoveryServer struct {
+	*ClusterCache
+
+	incrementalXDS bool
+
+	// Logger receives per-stream diagnostics. Defaults to
+	// logrus.StandardLogger() if nil, the same convention clusterVisitor.
+	// Logger uses.
+	Logger logrus.FieldLogger
+}
+
+// NewClusterDiscoveryServer registers a clusterDiscoveryServer backed by
+// clusters on s, so Envoy can connect to it over CDS. cfg.IncrementalXDS
+// gates whether DeltaClusters actually serves Envoy's incremental protocol
+// or returns Unimplemented.
+func NewClusterDiscoveryServer(s *grpc.Server, clusters *ClusterCache, cfg config.XDSServerConfig, log logrus.FieldLogger) {
+	v2.RegisterClusterDiscoveryServiceServer(s, &clusterDiscoveryServer{
+		ClusterCache:   clusters,
+		incrementalXDS: cfg.IncrementalXDS,
+		Logger:         log,
+	})
+}
+
+func (s *clusterDiscoveryServer) logger() logrus.FieldLogger {
+	if s.Logger != nil {
+		return s.Logger
+	}
+	return logrus.StandardLogger()
+}
+
+// resourceFilter returns a predicate matching any of names, or every
+// cluster if names is empty - the same "empty subscription means
+// everything" convention DeltaHandler uses for the delta protocol's
+// initial request.
+func resourceFilter(names []string) func(string) bool {
+	if len(names) == 0 {
+		return func(string) bool { return true }
+	}
+	set := make(map[string]bool, len(names))
+	for _, n := range names {
+		set[n] = true
+	}
+	return func(name string) bool { return set[name] }
+}
+
+// FetchClusters answers a single CDS poll with every cluster matching
+// req's ResourceNames.
+func (s *clusterDiscoveryServer) FetchClusters(ctx context.Context, req *v2.DiscoveryRequest) (*v2.DiscoveryResponse, error) {
+	values := s.Values(resourceFilter(req.ResourceNames))
+	resources := make([]*types.Any, 0, len(values))
+	for _, v := range values {
+		any, err := types.MarshalAny(v)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "marshalling cluster: %s", err)
+		}
+		resources = append(resources, any)
+	}
+
+	return &v2.DiscoveryResponse{
+		Resources: resources,
+		TypeUrl:   clusterTypeURL,
+	}, nil
+}
+
+// StreamClusters serves Envoy's State-of-the-World CDS stream: the first
+// DiscoveryRequest on the wire carries the subscription set, and the full
+// matching cluster set is resent every time ClusterCache changes
+// thereafter via Register/notify.
+func (s *clusterDiscoveryServer) StreamClusters(stream v2.ClusterDiscoveryService_StreamClustersServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	filter := resourceFilter(req.ResourceNames)
+
+	ch := make(chan int, 1)
+	s.Register(ch, 0)
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case version := <-ch:
+			values := s.Values(filter)
+			resources := make([]*types.Any, 0, len(values))
+			for _, v := range values {
+				any, err := types.MarshalAny(v)
+				if err != nil {
+					return status.Errorf(codes.Internal, "marshalling cluster: %s", err)
+				}
+				resources = append(resources, any)
+			}
+			resp := &v2.DiscoveryResponse{
+				VersionInfo: fmt.Sprintf("%d", version),
+				Resources:   resources,
+				TypeUrl:     clusterTypeURL,
+			}
+			if err := stream.Send(resp); err != nil {
+				return err
+			}
+			s.Register(ch, version)
+		}
+	}
+}
+
+// DeltaClusters serves Envoy's incremental CDS stream by answering each
+// DeltaDiscoveryRequest with DeltaHandler, the method that exists
+// specifically for this call site. A DeltaHandler response that falls
+// outside the cache's removal history (ok == false) is served as a full
+// resync: every current cluster resent as added, nothing reported removed.
+func (s *clusterDiscoveryServer) DeltaClusters(stream v2.ClusterDiscoveryService_DeltaClustersServer) error {
+	if !s.incrementalXDS {
+		return status.Error(codes.Unimplemented, "incremental xDS is disabled; set IncrementalXDS to enable DeltaAggregatedResources for CDS")
+	}
+
+	version := 0
+	for {
+		req, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		added, removed, next, ok := s.DeltaHandler(version, req.ResourceNamesSubscribe)
+		if !ok {
+			added = nil
+			for _, v := range s.Values(resourceFilter(req.ResourceNamesSubscribe)) {
+				c, ok := v.(*v2.Cluster)
+				if !ok {
+					continue
+				}
+				added = append(added, c)
+			}
+			removed = nil
+		}
+		version = next
+
+		resources := make([]*v2.Resource, 0, len(added))
+		for _, c := range added {
+			any, err := types.MarshalAny(c)
+			if err != nil {
+				return status.Errorf(codes.Internal, "marshalling cluster: %s", err)
+			}
+			resources = append(resources, &v2.Resource{
+				Name:     c.Name,
+				Version:  fmt.Sprintf("%d", version),
+				Resource: any,
+			})
+		}
+
+		resp := &v2.DeltaDiscoveryResponse{
+			SystemVersionInfo: fmt.Sprintf("%d", version),
+			Resources:         resources,
+			RemovedResources:  removed,
+			TypeUrl:           clusterTypeURL,
+			Nonce:             fmt.Sprintf("%d", version),
+		}
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contour
+
+import (
+	"context"
+	"testing"
+
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TestDeltaClustersGatedOnIncrementalXDS asserts that DeltaClusters refuses
+// to serve Envoy's incremental protocol - without even touching the stream
+// - unless IncrementalXDS was set when the server was constructed.
+func TestDeltaClustersGatedOnIncrementalXDS(t *testing.T) {
+	s := &clusterDiscoveryServer{ClusterCache: &ClusterCache{}}
+
+	err := s.DeltaClusters(nil)
+	if status.Code(err) != codes.Unimplemented {
+		t.Fatalf("DeltaClusters with IncrementalXDS unset: err = %v, want Unimplemented", err)
+	}
+}
+
+// TestFetchClusters asserts that FetchClusters answers with every cluster
+// currently in the cache when req.ResourceNames is empty.
+func TestFetchClusters(t *testing.T) {
+	cache := new(ClusterCache)
+	cache.Update(map[string]*v2.Cluster{
+		"default/backend/80/da39a3ee5e": {Name: "default/backend/80/da39a3ee5e"},
+	})
+
+	s := &clusterDiscoveryServer{ClusterCache: cache}
+
+	got, err := s.FetchClusters(context.Background(), &v2.DiscoveryRequest{})
+	if err != nil {
+		t.Fatalf("FetchClusters: unexpected error: %v", err)
+	}
+	if len(got.Resources) != 1 {
+		t.Fatalf("FetchClusters.Resources = %v, want 1 entry", got.Resources)
+	}
+	if got.TypeUrl != clusterTypeURL {
+		t.Fatalf("FetchClusters.TypeUrl = %q, want %q", got.TypeUrl, clusterTypeURL)
+	}
+}
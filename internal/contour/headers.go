@@ -0,0 +1,42 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contour
+
+import (
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	"github.com/gogo/protobuf/types"
+	ingressroutev1 "github.com/heptio/contour/apis/contour/v1beta1"
+)
+
+// headerValueOptions converts a set of IngressRoute header values into the
+// core.HeaderValueOption slice accepted by route.Route, route.VirtualHost,
+// and route.WeightedCluster.ClusterWeight. Envoy format specifiers such as
+// %DOWNSTREAM_REMOTE_ADDRESS% are passed straight through in Value; Envoy
+// interprets them at request time.
+func headerValueOptions(headers []ingressroutev1.HeaderValue) []*core.HeaderValueOption {
+	if len(headers) == 0 {
+		return nil
+	}
+	options := make([]*core.HeaderValueOption, 0, len(headers))
+	for _, h := range headers {
+		options = append(options, &core.HeaderValueOption{
+			Header: &core.HeaderValue{
+				Key:   h.Name,
+				Value: h.Value,
+			},
+			Append: &types.BoolValue{Value: true},
+		})
+	}
+	return options
+}
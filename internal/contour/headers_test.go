@@ -0,0 +1,48 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contour
+
+import (
+	"testing"
+
+	ingressroutev1 "github.com/heptio/contour/apis/contour/v1beta1"
+)
+
+// TestHeaderValueOptions asserts that each IngressRoute header value is
+// translated into an Append-semantics core.HeaderValueOption, and that a
+// nil/empty input produces no options rather than an empty-but-non-nil
+// slice (route.Route and route.VirtualHost treat the two differently when
+// merging with RDS defaults).
+func TestHeaderValueOptions(t *testing.T) {
+	if got := headerValueOptions(nil); got != nil {
+		t.Fatalf("headerValueOptions(nil) = %v, want nil", got)
+	}
+
+	headers := []ingressroutev1.HeaderValue{
+		{Name: "x-request-start", Value: "%START_TIME%"},
+		{Name: "x-team", Value: "eng"},
+	}
+	got := headerValueOptions(headers)
+	if len(got) != len(headers) {
+		t.Fatalf("headerValueOptions(%v) returned %d options, want %d", headers, len(got), len(headers))
+	}
+	for i, h := range headers {
+		if got[i].Header.Key != h.Name || got[i].Header.Value != h.Value {
+			t.Fatalf("headerValueOptions(%v)[%d] = %+v, want Key/Value %s/%s", headers, i, got[i].Header, h.Name, h.Value)
+		}
+		if !got[i].Append.Value {
+			t.Fatalf("headerValueOptions(%v)[%d].Append = false, want true so an existing header is appended to, not replaced", headers, i)
+		}
+	}
+}
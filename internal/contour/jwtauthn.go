@@ -0,0 +1,133 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contour
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	jwtauthn "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/jwt_authn/v2alpha"
+	hcm "github.com/envoyproxy/go-control-plane/envoy/config/filter/network/http_connection_manager/v2"
+	"github.com/gogo/protobuf/types"
+
+	"github.com/heptio/contour/internal/dag"
+	"github.com/heptio/contour/internal/envoy"
+)
+
+// jwtAuthnFilterName is both the HCM http_filters entry name and the
+// TypedPerFilterConfig key a Route uses to reference its JWTRequirement;
+// Envoy keys per-route filter overrides by the same name the filter itself
+// is registered under.
+const jwtAuthnFilterName = "envoy.filters.http.jwt_authn"
+
+// BuildJWTAuthnFilter builds the jwt_authn HTTP filter for an HCM's
+// http_filters list from every JWTProvider declared across the DAG. The
+// filter must be ordered before any RBAC filter and before the router in
+// that list, so RBAC (and the upstream) only ever sees a request whose JWT,
+// if one was required, has already been verified; building that ordering
+// is the HCM/listener assembly's responsibility, not this function's,
+// since no listener.go exists in this package to do it in.
+//
+// Returns nil if providers is empty: an HCM with no JWTProvider declared
+// anywhere has nothing for the filter to validate, and Envoy rejects an
+// http_filters entry with no providers configured.
+func BuildJWTAuthnFilter(providers map[string]*dag.JWTProvider) (*hcm.HttpFilter, error) {
+	if len(providers) == 0 {
+		return nil, nil
+	}
+
+	config := &jwtauthn.JwtAuthentication{
+		Providers:      make(map[string]*jwtauthn.JwtProvider, len(providers)),
+		RequirementMap: make(map[string]*jwtauthn.JwtRequirement, len(providers)),
+	}
+
+	// Providers are visited in name order. Providers and RequirementMap
+	// are themselves maps, so this order does not carry into the config:
+	// whether two calls marshal to identical bytes depends on how
+	// types.MarshalAny encodes map entries, not on this loop.
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		p := providers[name]
+		config.Providers[name] = jwtProviderConfig(p)
+		config.RequirementMap[name] = &jwtauthn.JwtRequirement{
+			RequiresType: &jwtauthn.JwtRequirement_ProviderName{ProviderName: name},
+		}
+	}
+
+	any, err := types.MarshalAny(config)
+	if err != nil {
+		return nil, fmt.Errorf("jwt_authn: marshalling filter config: %s", err)
+	}
+
+	return &hcm.HttpFilter{
+		Name:       jwtAuthnFilterName,
+		ConfigType: &hcm.HttpFilter_TypedConfig{TypedConfig: any},
+	}, nil
+}
+
+// jwtProviderConfig translates a single dag.JWTProvider into the
+// jwt_authn filter's per-provider config: where to fetch its JWKS from
+// (the JWKS cluster jwkscluster builds for it, named the same way),
+// whether the verified JWT itself should still reach the upstream, and
+// which claims to copy onto request headers.
+func jwtProviderConfig(p *dag.JWTProvider) *jwtauthn.JwtProvider {
+	return &jwtauthn.JwtProvider{
+		Issuer:    p.Issuer,
+		Audiences: p.Audiences,
+		JwksSourceSpecifier: &jwtauthn.JwtProvider_RemoteJwks{
+			RemoteJwks: &jwtauthn.RemoteJwks{
+				HttpUri: &core.HttpUri{
+					Uri: fmt.Sprintf("%s://%s:%d", p.JWKSScheme, p.JWKSHostname, p.JWKSPort),
+					HttpUpstreamType: &core.HttpUri_Cluster{
+						Cluster: envoy.Clustername(p),
+					},
+				},
+			},
+		},
+		Forward:        p.ForwardJWT,
+		ClaimToHeaders: jwtClaimToHeaders(p.ClaimToHeaders),
+	}
+}
+
+func jwtClaimToHeaders(claims []dag.JWTClaimToHeader) []*jwtauthn.JwtClaimToHeader {
+	if len(claims) == 0 {
+		return nil
+	}
+	out := make([]*jwtauthn.JwtClaimToHeader, 0, len(claims))
+	for _, c := range claims {
+		out = append(out, &jwtauthn.JwtClaimToHeader{ClaimName: c.Claim, HeaderName: c.Header})
+	}
+	return out
+}
+
+// jwtRequirementPerRoute builds the TypedPerFilterConfig entry that tells
+// the jwt_authn filter which of its RequirementMap entries (built by
+// BuildJWTAuthnFilter, one per provider name) this particular route must
+// satisfy before RBAC or the upstream are reached.
+func jwtRequirementPerRoute(providerName string) (*types.Any, error) {
+	cfg := &jwtauthn.PerRouteConfig{
+		RequirementSpecifier: &jwtauthn.PerRouteConfig_RequirementName{RequirementName: providerName},
+	}
+	any, err := types.MarshalAny(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("jwt_authn: marshalling per-route config for provider %q: %s", providerName, err)
+	}
+	return any, nil
+}
@@ -0,0 +1,91 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contour
+
+import (
+	"testing"
+
+	jwtauthn "github.com/envoyproxy/go-control-plane/envoy/config/filter/http/jwt_authn/v2alpha"
+	"github.com/gogo/protobuf/proto"
+
+	ingressroutev1 "github.com/heptio/contour/apis/contour/v1beta1"
+	"github.com/heptio/contour/internal/dag"
+)
+
+// TestBuildJWTAuthnFilterEmpty asserts that an HCM with no JWTProvider
+// declared anywhere gets no jwt_authn filter at all, rather than one with an
+// empty (and Envoy-rejected) provider map.
+func TestBuildJWTAuthnFilterEmpty(t *testing.T) {
+	got, err := BuildJWTAuthnFilter(nil)
+	if err != nil {
+		t.Fatalf("BuildJWTAuthnFilter(nil): unexpected error: %v", err)
+	}
+	if got != nil {
+		t.Fatalf("BuildJWTAuthnFilter(nil) = %v, want nil", got)
+	}
+}
+
+// TestBuildJWTAuthnFilter asserts that a non-empty providers map produces a
+// named jwt_authn HttpFilter whose TypedConfig contains one Provider and one
+// RequirementMap entry per provider name.
+func TestBuildJWTAuthnFilter(t *testing.T) {
+	spec := ingressroutev1.JWTProvider{
+		Name:    "google",
+		Issuer:  "https://accounts.google.com",
+		JWKSURI: "https://www.googleapis.com/oauth2/v3/certs",
+	}
+	provider, err := dag.BuildJWTProvider("default", spec)
+	if err != nil {
+		t.Fatalf("BuildJWTProvider: unexpected error: %v", err)
+	}
+
+	got, err := BuildJWTAuthnFilter(map[string]*dag.JWTProvider{"google": provider})
+	if err != nil {
+		t.Fatalf("BuildJWTAuthnFilter: unexpected error: %v", err)
+	}
+	if got == nil {
+		t.Fatal("BuildJWTAuthnFilter = nil, want a filter")
+	}
+	if got.Name != jwtAuthnFilterName {
+		t.Fatalf("BuildJWTAuthnFilter.Name = %q, want %q", got.Name, jwtAuthnFilterName)
+	}
+
+	var cfg jwtauthn.JwtAuthentication
+	if err := proto.Unmarshal(got.GetTypedConfig().Value, &cfg); err != nil {
+		t.Fatalf("unmarshalling filter config: %v", err)
+	}
+	if _, ok := cfg.Providers["google"]; !ok {
+		t.Fatalf("JwtAuthentication.Providers = %v, want an entry for %q", cfg.Providers, "google")
+	}
+	if _, ok := cfg.RequirementMap["google"]; !ok {
+		t.Fatalf("JwtAuthentication.RequirementMap = %v, want an entry for %q", cfg.RequirementMap, "google")
+	}
+}
+
+// TestJWTRequirementPerRoute asserts that the per-route config names the
+// provider the route was resolved to by dag.ValidateJWTRequirement.
+func TestJWTRequirementPerRoute(t *testing.T) {
+	any, err := jwtRequirementPerRoute("google")
+	if err != nil {
+		t.Fatalf("jwtRequirementPerRoute: unexpected error: %v", err)
+	}
+
+	var cfg jwtauthn.PerRouteConfig
+	if err := proto.Unmarshal(any.Value, &cfg); err != nil {
+		t.Fatalf("unmarshalling per-route config: %v", err)
+	}
+	if cfg.GetRequirementName() != "google" {
+		t.Fatalf("PerRouteConfig.RequirementName = %q, want %q", cfg.GetRequirementName(), "google")
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contour
+
+import (
+	route "github.com/envoyproxy/go-control-plane/envoy/api/v2/route"
+	tracing "github.com/envoyproxy/go-control-plane/envoy/config/trace/v2"
+	envoy_type "github.com/envoyproxy/go-control-plane/envoy/type"
+	"github.com/gogo/protobuf/types"
+	"github.com/sirupsen/logrus"
+
+	"github.com/heptio/contour/internal/dag"
+	"github.com/heptio/contour/internal/envoy"
+)
+
+// routeVisitor walks a *dag.DAG and produces the route.VirtualHost RDS
+// Envoy serves, the RDS-side counterpart to clusterVisitor's CDS output.
+// Like clusterVisitor, a VirtualHost reachable from more than one path
+// through the DAG is only built once.
+type routeVisitor struct {
+	dag.Visitable
+
+	// TracingPolicies carries each VirtualHost's validated tracing
+	// configuration, keyed by the VirtualHost's fqdn (unlike
+	// clusterVisitor.TracingPolicies, which keys by EDS cluster name,
+	// since routeVisitor builds one route.Route per VirtualHost route
+	// rather than one per backing Service). The DAG builder does not fill
+	// this map in; it holds only what the code constructing routeVisitor
+	// sets.
+	TracingPolicies map[string]*dag.TracingPolicy
+
+	// RequestHeaderPolicies and ResponseHeaderPolicies carry each
+	// VirtualHost's validated header manipulation, keyed by the
+	// VirtualHost's fqdn the same way TracingPolicies is. A VirtualHost's
+	// policy is applied to the VirtualHost itself, and to any route it
+	// owns that has no policy of its own in RouteRequestHeaderPolicies /
+	// RouteResponseHeaderPolicies.
+	RequestHeaderPolicies  map[string]*dag.HeaderPolicy
+	ResponseHeaderPolicies map[string]*dag.HeaderPolicy
+
+	// RouteRequestHeaderPolicies and RouteResponseHeaderPolicies carry a
+	// single route's own header manipulation, overriding the owning
+	// VirtualHost's policy for that route alone. They're keyed by the
+	// *dag.Route pointer itself rather than a generated name: unlike a
+	// Service or a VirtualHost, a Route has no name of its own, but the
+	// IngressRoute processor and routeVisitor walk the same DAG, so the
+	// pointer is a stable enough handle for the single Visit() pass that
+	// populates virtualHosts.
+	RouteRequestHeaderPolicies  map[*dag.Route]*dag.HeaderPolicy
+	RouteResponseHeaderPolicies map[*dag.Route]*dag.HeaderPolicy
+
+	// ClusterRequestHeaderPolicies and ClusterResponseHeaderPolicies carry
+	// a weighted backend's own header manipulation, keyed by EDS cluster
+	// name the same way clusterVisitor.TLSOverrides is. Applied to the
+	// matching route.WeightedCluster_ClusterWeight when a route has more
+	// than one backing Service and weightedClusters builds a
+	// RouteAction_WeightedClusters for it.
+	ClusterRequestHeaderPolicies  map[string]*dag.HeaderPolicy
+	ClusterResponseHeaderPolicies map[string]*dag.HeaderPolicy
+
+	// RouteJWTRequirements carries the JWTProvider a route's
+	// spec.routes[].jwtRequirement resolved to (via
+	// dag.ValidateJWTRequirement), keyed by the *dag.Route pointer the
+	// same way RouteRequestHeaderPolicies is. route() turns this into the
+	// TypedPerFilterConfig entry that tells the jwt_authn filter this
+	// route must be authenticated by that provider before it is routed.
+	RouteJWTRequirements map[*dag.Route]*dag.JWTProvider
+
+	// Logger receives structured diagnostics for any panic recovered while
+	// visiting the DAG. Defaults to logrus.StandardLogger() if nil, the
+	// same convention clusterVisitor.Logger uses.
+	Logger logrus.FieldLogger
+
+	virtualHosts map[string]*route.VirtualHost
+}
+
+func (v *routeVisitor) Visit() map[string]*route.VirtualHost {
+	v.virtualHosts = make(map[string]*route.VirtualHost)
+	v.Visitable.Visit(v.visit)
+	return v.virtualHosts
+}
+
+func (v *routeVisitor) visit(vertex dag.Vertex) {
+	// See clusterVisitor.visit: a bad vertex must not crash the whole RDS
+	// translation goroutine and brown out every Envoy in the cluster.
+	defer v.recoverPanic(vertex)
+
+	if vh, ok := vertex.(*dag.VirtualHost); ok {
+		v.virtualhost(vh)
+	}
+	vertex.Visit(v.visit)
+}
+
+// recoverPanic recovers from a panic raised while translating vertex,
+// bumping contour_dag_visit_panics_total{visitor="route"}. It is a no-op
+// unless a panic is in flight.
+func (v *routeVisitor) recoverPanic(vertex dag.Vertex) {
+	recoverDagVisitPanic("route", vertex, recover(), v.logger())
+}
+
+func (v *routeVisitor) logger() logrus.FieldLogger {
+	if v.Logger != nil {
+		return v.Logger
+	}
+	return logrus.StandardLogger()
+}
+
+func (v *routeVisitor) virtualhost(vh *dag.VirtualHost) {
+	name := vh.Name()
+	if _, ok := v.virtualHosts[name]; ok {
+		// already built this VirtualHost via another edge. skip it.
+		return
+	}
+
+	rv := &route.VirtualHost{
+		Name:    name,
+		Domains: []string{name},
+	}
+	if policy, ok := v.RequestHeaderPolicies[name]; ok {
+		rv.RequestHeadersToAdd = headerValueOptions(policy.Add)
+		rv.RequestHeadersToRemove = policy.Remove
+	}
+	if policy, ok := v.ResponseHeaderPolicies[name]; ok {
+		rv.ResponseHeadersToAdd = headerValueOptions(policy.Add)
+		rv.ResponseHeadersToRemove = policy.Remove
+	}
+
+	vh.Visit(func(child dag.Vertex) {
+		if r, ok := child.(*dag.Route); ok {
+			rv.Routes = append(rv.Routes, v.route(name, r))
+		}
+	})
+
+	v.virtualHosts[name] = rv
+}
+
+// route builds a route.Route, applying r's own header manipulation policy
+// if it has one, falling back to virtualHostName's otherwise, so
+// spec.virtualhost.requestHeadersPolicy/responseHeadersPolicy is applied to
+// every route that doesn't set its own spec.routes[].requestHeadersPolicy/
+// responseHeadersPolicy, in addition to the route.VirtualHost that
+// virtualhost sets it on. Tracing remains VirtualHost-only, since no
+// request has asked for a per-route override of it. When r has more than
+// one backing Service, its Action is a RouteAction_WeightedClusters built
+// by weightedClusters; a single-backend route's Action is built elsewhere.
+func (v *routeVisitor) route(virtualHostName string, r *dag.Route) *route.Route {
+	rt := &route.Route{}
+	if policy, ok := v.TracingPolicies[virtualHostName]; ok {
+		rt.Tracing = tracingConfig(policy)
+	}
+
+	reqPolicy := v.RouteRequestHeaderPolicies[r]
+	if reqPolicy == nil {
+		reqPolicy = v.RequestHeaderPolicies[virtualHostName]
+	}
+	if reqPolicy != nil {
+		rt.RequestHeadersToAdd = headerValueOptions(reqPolicy.Add)
+		rt.RequestHeadersToRemove = reqPolicy.Remove
+	}
+
+	respPolicy := v.RouteResponseHeaderPolicies[r]
+	if respPolicy == nil {
+		respPolicy = v.ResponseHeaderPolicies[virtualHostName]
+	}
+	if respPolicy != nil {
+		rt.ResponseHeadersToAdd = headerValueOptions(respPolicy.Add)
+		rt.ResponseHeadersToRemove = respPolicy.Remove
+	}
+
+	if weighted := v.weightedClusters(r); weighted != nil {
+		rt.Action = &route.Route_Route{
+			Route: &route.RouteAction{
+				ClusterSpecifier: &route.RouteAction_WeightedClusters{
+					WeightedClusters: weighted,
+				},
+			},
+		}
+	}
+
+	if provider, ok := v.RouteJWTRequirements[r]; ok {
+		any, err := jwtRequirementPerRoute(provider.Name())
+		if err != nil {
+			// A marshalling failure here means the route would silently
+			// ship with no JWT requirement attached, i.e. unauthenticated;
+			// panicking (and letting recoverPanic skip just this vertex)
+			// is safer than serving that route unprotected.
+			panic(err)
+		}
+		rt.TypedPerFilterConfig = map[string]*types.Any{
+			jwtAuthnFilterName: any,
+		}
+	}
+
+	return rt
+}
+
+// weightedClusters builds the WeightedCluster Envoy uses to split traffic
+// across r's backing Services by weight, applying each backend's
+// ClusterRequestHeaderPolicies/ClusterResponseHeaderPolicies. Returns nil
+// when r has fewer than two backing Services, since weighted routing -
+// and therefore per-ClusterWeight headers - only applies once there's more
+// than one backend to split traffic across.
+func (v *routeVisitor) weightedClusters(r *dag.Route) *route.WeightedCluster {
+	var clusters []*route.WeightedCluster_ClusterWeight
+	r.Visit(func(child dag.Vertex) {
+		svc, ok := child.(*dag.Service)
+		if !ok {
+			return
+		}
+		clusters = append(clusters, v.clusterWeight(svc))
+	})
+	if len(clusters) < 2 {
+		return nil
+	}
+	return &route.WeightedCluster{Clusters: clusters}
+}
+
+// clusterWeight builds a single route.WeightedCluster_ClusterWeight for
+// svc, applying its ClusterRequestHeaderPolicies/
+// ClusterResponseHeaderPolicies entry if it has one. Split out of
+// weightedClusters so the header-merging logic can be tested without
+// needing a *dag.Route to traverse.
+func (v *routeVisitor) clusterWeight(svc *dag.Service) *route.WeightedCluster_ClusterWeight {
+	name := envoy.Clustername(svc)
+	cw := &route.WeightedCluster_ClusterWeight{
+		Name:   name,
+		Weight: u32(svc.Weight),
+	}
+	if policy, ok := v.ClusterRequestHeaderPolicies[name]; ok {
+		cw.RequestHeadersToAdd = headerValueOptions(policy.Add)
+		cw.RequestHeadersToRemove = policy.Remove
+	}
+	if policy, ok := v.ClusterResponseHeaderPolicies[name]; ok {
+		cw.ResponseHeadersToAdd = headerValueOptions(policy.Add)
+		cw.ResponseHeadersToRemove = policy.Remove
+	}
+	return cw
+}
+
+// tracingConfig translates a dag.TracingPolicy into the
+// envoy.api.v2.route.Tracing Envoy attaches to a Route to control sampling
+// and custom tags for spans that route produces.
+func tracingConfig(policy *dag.TracingPolicy) *route.Tracing {
+	t := &route.Tracing{
+		CustomTags: tracingCustomTags(policy.CustomTags),
+	}
+	if policy.ClientSampling != nil {
+		t.ClientSampling = &envoy_type.Percent{Value: *policy.ClientSampling}
+	}
+	return t
+}
+
+// tracingCustomTags converts a TracingPolicy's custom tags into the Envoy
+// CustomTag oneof: a literal value, or a value copied from a request
+// header.
+func tracingCustomTags(tags []dag.TracingCustomTag) []*tracing.CustomTag {
+	if len(tags) == 0 {
+		return nil
+	}
+	out := make([]*tracing.CustomTag, 0, len(tags))
+	for _, tag := range tags {
+		ct := &tracing.CustomTag{Tag: tag.Tag}
+		switch {
+		case tag.Literal != "":
+			ct.Type = &tracing.CustomTag_Literal_{
+				Literal: &tracing.CustomTag_Literal{Value: tag.Literal},
+			}
+		case tag.RequestHeaderName != "":
+			ct.Type = &tracing.CustomTag_RequestHeader{
+				RequestHeader: &tracing.CustomTag_Header{Name: tag.RequestHeaderName},
+			}
+		}
+		out = append(out, ct)
+	}
+	return out
+}
@@ -0,0 +1,156 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package contour
+
+import (
+	"testing"
+
+	ingressroutev1 "github.com/heptio/contour/apis/contour/v1beta1"
+	"github.com/heptio/contour/internal/dag"
+	"github.com/heptio/contour/internal/envoy"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// panicVertex is a dag.Vertex whose Visit always panics, used to exercise
+// routeVisitor's panic recovery without depending on the internals of the
+// external dag.VirtualHost/dag.Route types.
+type panicVertex struct{}
+
+func (panicVertex) Visit(func(dag.Vertex)) {
+	panic("boom")
+}
+
+// recordingVertex is a dag.Vertex that records whether it was visited.
+type recordingVertex struct {
+	visited *bool
+}
+
+func (r recordingVertex) Visit(func(dag.Vertex)) {
+	*r.visited = true
+}
+
+// TestRouteVisitorSkipsVertexOnPanic asserts that a vertex which panics
+// while being visited - the RDS equivalent of the nil ServicePort case
+// TestClusterVisitorSkipsVertexOnPanic covers for CDS - does not prevent
+// routeVisitor from visiting the remaining, healthy siblings.
+func TestRouteVisitorSkipsVertexOnPanic(t *testing.T) {
+	var visited bool
+	v := &routeVisitor{
+		Visitable: fixedVisitable{panicVertex{}, recordingVertex{visited: &visited}},
+	}
+
+	v.Visit()
+
+	if !visited {
+		t.Fatal("recordingVertex was not visited: a panic in a sibling vertex should not stop routeVisitor from visiting the rest of the DAG")
+	}
+}
+
+// TestRouteVisitorRouteHeaderPolicyOverridesVirtualHost asserts that a
+// route's own entry in RouteRequestHeaderPolicies/RouteResponseHeaderPolicies
+// wins over its VirtualHost's default, rather than the VirtualHost policy
+// always being blanket-applied regardless of what the route itself asked
+// for.
+func TestRouteVisitorRouteHeaderPolicyOverridesVirtualHost(t *testing.T) {
+	r := &dag.Route{}
+	vhostPolicy := &dag.HeaderPolicy{Add: []ingressroutev1.HeaderValue{{Name: "x-vhost", Value: "1"}}}
+	routePolicy := &dag.HeaderPolicy{Add: []ingressroutev1.HeaderValue{{Name: "x-route", Value: "1"}}}
+
+	v := &routeVisitor{
+		RequestHeaderPolicies:      map[string]*dag.HeaderPolicy{"example.com": vhostPolicy},
+		RouteRequestHeaderPolicies: map[*dag.Route]*dag.HeaderPolicy{r: routePolicy},
+	}
+
+	got := v.route("example.com", r)
+	if len(got.RequestHeadersToAdd) != 1 || got.RequestHeadersToAdd[0].Header.Key != "x-route" {
+		t.Fatalf("route(%q, r).RequestHeadersToAdd = %v, want the route's own policy (x-route) to win over the VirtualHost default (x-vhost)", "example.com", got.RequestHeadersToAdd)
+	}
+}
+
+// TestRouteVisitorRouteHeaderPolicyFallsBackToVirtualHost asserts that a
+// route with no entry of its own still gets its VirtualHost's policy,
+// preserving the pre-existing blanket-apply behaviour for routes that don't
+// set their own.
+func TestRouteVisitorRouteHeaderPolicyFallsBackToVirtualHost(t *testing.T) {
+	r := &dag.Route{}
+	vhostPolicy := &dag.HeaderPolicy{Add: []ingressroutev1.HeaderValue{{Name: "x-vhost", Value: "1"}}}
+
+	v := &routeVisitor{
+		RequestHeaderPolicies: map[string]*dag.HeaderPolicy{"example.com": vhostPolicy},
+	}
+
+	got := v.route("example.com", r)
+	if len(got.RequestHeadersToAdd) != 1 || got.RequestHeadersToAdd[0].Header.Key != "x-vhost" {
+		t.Fatalf("route(%q, r).RequestHeadersToAdd = %v, want the VirtualHost default applied since the route has no override", "example.com", got.RequestHeadersToAdd)
+	}
+}
+
+// TestRouteVisitorRouteJWTRequirement asserts that a route with an entry in
+// RouteJWTRequirements gets a TypedPerFilterConfig entry naming that
+// provider, so the jwt_authn filter knows to enforce it for that route.
+func TestRouteVisitorRouteJWTRequirement(t *testing.T) {
+	r := &dag.Route{}
+	provider, err := dag.BuildJWTProvider("default", ingressroutev1.JWTProvider{
+		Name:    "google",
+		JWKSURI: "https://www.googleapis.com/oauth2/v3/certs",
+	})
+	if err != nil {
+		t.Fatalf("BuildJWTProvider: unexpected error: %v", err)
+	}
+
+	v := &routeVisitor{
+		RouteJWTRequirements: map[*dag.Route]*dag.JWTProvider{r: provider},
+	}
+
+	got := v.route("example.com", r)
+	any, ok := got.TypedPerFilterConfig[jwtAuthnFilterName]
+	if !ok {
+		t.Fatalf("route(%q, r).TypedPerFilterConfig = %v, want an entry for %q", "example.com", got.TypedPerFilterConfig, jwtAuthnFilterName)
+	}
+	if any == nil {
+		t.Fatalf("route(%q, r).TypedPerFilterConfig[jwtAuthnFilterName] = nil, want a marshalled PerRouteConfig", "example.com")
+	}
+}
+
+// TestRouteVisitorClusterWeight asserts that clusterWeight applies a
+// per-cluster header policy, keyed by the same EDS cluster name
+// clusterVisitor uses, to the ClusterWeight it builds for a weighted
+// backend.
+func TestRouteVisitorClusterWeight(t *testing.T) {
+	svc := &dag.Service{
+		Object: &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "canary"},
+		},
+		ServicePort: &v1.ServicePort{Name: "http", Port: 80},
+		Weight:      10,
+	}
+
+	v := &routeVisitor{
+		ClusterRequestHeaderPolicies: map[string]*dag.HeaderPolicy{
+			envoy.Clustername(svc): {Add: []ingressroutev1.HeaderValue{{Name: "x-canary", Value: "true"}}},
+		},
+	}
+
+	got := v.clusterWeight(svc)
+	if got.Name != envoy.Clustername(svc) {
+		t.Fatalf("clusterWeight(svc).Name = %q, want %q", got.Name, envoy.Clustername(svc))
+	}
+	if got.Weight == nil || got.Weight.Value != 10 {
+		t.Fatalf("clusterWeight(svc).Weight = %v, want 10", got.Weight)
+	}
+	if len(got.RequestHeadersToAdd) != 1 || got.RequestHeadersToAdd[0].Header.Key != "x-canary" {
+		t.Fatalf("clusterWeight(svc).RequestHeadersToAdd = %v, want the ClusterRequestHeaderPolicies entry for %q applied", got.RequestHeadersToAdd, envoy.Clustername(svc))
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dag
+
+import (
+	"fmt"
+	"strings"
+
+	ingressroutev1 "github.com/heptio/contour/apis/contour/v1beta1"
+)
+
+// hopByHopHeaders are forbidden in a HeaderPolicy's Add/Remove because
+// Envoy manages them itself; letting an IngressRoute author set them would
+// either be silently overridden or break the connection.
+var hopByHopHeaders = map[string]bool{
+	"connection":          true,
+	"keep-alive":          true,
+	"proxy-authenticate":  true,
+	"proxy-authorization": true,
+	"te":                  true,
+	"trailer":             true,
+	"transfer-encoding":   true,
+	"upgrade":             true,
+}
+
+// validateHeaderName returns an error if name is one Envoy forbids route
+// and virtualhost level header manipulation from touching: the synthetic
+// pseudo-headers that drive routing, and hop-by-hop headers.
+func validateHeaderName(name string) error {
+	switch lower := strings.ToLower(name); {
+	case strings.HasPrefix(lower, ":"), lower == "host":
+		return fmt.Errorf("header manipulation of %q is not permitted", name)
+	}
+	if hopByHopHeaders[strings.ToLower(name)] {
+		return fmt.Errorf("header manipulation of hop-by-hop header %q is not permitted", name)
+	}
+	return nil
+}
+
+// HeaderPolicy is the validated form of an IngressRoute's HeaderPolicy.
+// routeVisitor carries one per VirtualHost (keyed by fqdn), per Route
+// (keyed by the *dag.Route pointer), and per weighted backend (keyed by
+// EDS cluster name), none of which require a new field on dag.VirtualHost,
+// dag.Route, or dag.Service.
+type HeaderPolicy struct {
+	Add    []ingressroutev1.HeaderValue
+	Remove []string
+}
+
+// BuildHeaderPolicy validates and translates an IngressRoute's
+// RequestHeadersPolicy or ResponseHeadersPolicy, rejecting any attempt to
+// manipulate Envoy's synthetic pseudo-headers or a hop-by-hop header at
+// admission time rather than silently passing it through to Envoy.
+func BuildHeaderPolicy(spec ingressroutev1.HeaderPolicy) (*HeaderPolicy, error) {
+	for _, h := range spec.Add {
+		if err := validateHeaderName(h.Name); err != nil {
+			return nil, err
+		}
+	}
+	for _, h := range spec.Remove {
+		if err := validateHeaderName(h); err != nil {
+			return nil, err
+		}
+	}
+	return &HeaderPolicy{Add: spec.Add, Remove: spec.Remove}, nil
+}
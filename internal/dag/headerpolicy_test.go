@@ -0,0 +1,64 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dag
+
+import (
+	"testing"
+
+	ingressroutev1 "github.com/heptio/contour/apis/contour/v1beta1"
+)
+
+func TestBuildHeaderPolicy(t *testing.T) {
+	tests := map[string]struct {
+		spec    ingressroutev1.HeaderPolicy
+		wantErr bool
+	}{
+		"valid add and remove": {
+			spec: ingressroutev1.HeaderPolicy{
+				Add:    []ingressroutev1.HeaderValue{{Name: "x-request-start", Value: "%START_TIME%"}},
+				Remove: []string{"x-internal-debug"},
+			},
+		},
+		"adding a pseudo-header is rejected": {
+			spec:    ingressroutev1.HeaderPolicy{Add: []ingressroutev1.HeaderValue{{Name: ":authority", Value: "evil.example.com"}}},
+			wantErr: true,
+		},
+		"adding host is rejected": {
+			spec:    ingressroutev1.HeaderPolicy{Add: []ingressroutev1.HeaderValue{{Name: "Host", Value: "evil.example.com"}}},
+			wantErr: true,
+		},
+		"removing a hop-by-hop header is rejected": {
+			spec:    ingressroutev1.HeaderPolicy{Remove: []string{"Connection"}},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := BuildHeaderPolicy(tc.spec)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("BuildHeaderPolicy(%v): err = nil, want error", tc.spec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BuildHeaderPolicy(%v): unexpected error: %v", tc.spec, err)
+			}
+			if len(got.Add) != len(tc.spec.Add) || len(got.Remove) != len(tc.spec.Remove) {
+				t.Fatalf("BuildHeaderPolicy(%v) = %+v, want Add/Remove of the same length as input", tc.spec, got)
+			}
+		})
+	}
+}
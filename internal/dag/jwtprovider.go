@@ -0,0 +1,140 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dag
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	ingressroutev1 "github.com/heptio/contour/apis/contour/v1beta1"
+)
+
+// JWTProvider is a DAG vertex representing a single named JWT provider
+// referenced by one or more IngressRoutes' spec.virtualhost.jwtProviders.
+// Because the same provider can be referenced by many routes, it is
+// modelled as a vertex of its own, reachable from every route that names
+// it, rather than duplicated per route: clusterVisitor and the listener's
+// jwt_authn filter config each only build one copy of it.
+type JWTProvider struct {
+	providerName      string
+	providerNamespace string
+
+	Issuer         string
+	Audiences      []string
+	ForwardJWT     bool
+	ClaimToHeaders []JWTClaimToHeader
+
+	// JWKSScheme, JWKSHostname and JWKSPort are parsed from JWKSURI and
+	// used to build the remote JWKS cluster in clusterVisitor.
+	JWKSScheme   string
+	JWKSHostname string
+	JWKSPort     int
+
+	// CACertificate names the Secret used to validate the JWKS endpoint's
+	// certificate when JWKSScheme is "https".
+	CACertificate string
+}
+
+// JWTClaimToHeader copies a single verified JWT claim onto a request
+// header before the request reaches RBAC or the upstream.
+type JWTClaimToHeader struct {
+	Claim  string
+	Header string
+}
+
+// Namespace returns the namespace of the IngressRoute that declared this
+// provider.
+func (p *JWTProvider) Namespace() string { return p.providerNamespace }
+
+// Name returns the provider's name, as declared in
+// spec.virtualhost.jwtProviders[].name.
+func (p *JWTProvider) Name() string { return p.providerName }
+
+// Visit satisfies Vertex. JWTProvider is a leaf: it has no DAG children.
+func (p *JWTProvider) Visit(func(Vertex)) {}
+
+// defaultJWKSPort is used when a provider's JWKSURI does not specify one
+// explicitly, matching net/url / net/http's own default port behaviour.
+func defaultJWKSPort(scheme string) int {
+	if scheme == "https" {
+		return 443
+	}
+	return 80
+}
+
+// BuildJWTProvider translates an IngressRoute's declared JWTProvider into
+// the DAG vertex clusterVisitor and the listener visitor consume, parsing
+// JWKSURI into the scheme/hostname/port the JWKS cluster is built from.
+// The DAG builder does not call it.
+func BuildJWTProvider(namespace string, spec ingressroutev1.JWTProvider) (*JWTProvider, error) {
+	if spec.Name == "" {
+		return nil, fmt.Errorf("jwtProviders: name is required")
+	}
+
+	u, err := url.Parse(spec.JWKSURI)
+	if err != nil {
+		return nil, fmt.Errorf("jwtProviders: provider %q: invalid jwksURI: %s", spec.Name, err)
+	}
+	switch u.Scheme {
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("jwtProviders: provider %q: jwksURI scheme must be http or https, got %q", spec.Name, u.Scheme)
+	}
+
+	port := defaultJWKSPort(u.Scheme)
+	host := u.Hostname()
+	if p := u.Port(); p != "" {
+		port, err = strconv.Atoi(p)
+		if err != nil {
+			return nil, fmt.Errorf("jwtProviders: provider %q: invalid port in jwksURI: %s", spec.Name, err)
+		}
+	}
+	if host == "" {
+		return nil, fmt.Errorf("jwtProviders: provider %q: jwksURI has no host", spec.Name)
+	}
+
+	claimToHeaders := make([]JWTClaimToHeader, 0, len(spec.ClaimToHeaders))
+	for _, c := range spec.ClaimToHeaders {
+		claimToHeaders = append(claimToHeaders, JWTClaimToHeader{Claim: c.Claim, Header: c.Header})
+	}
+
+	return &JWTProvider{
+		providerName:      spec.Name,
+		providerNamespace: namespace,
+		Issuer:            spec.Issuer,
+		Audiences:         spec.Audiences,
+		ForwardJWT:        spec.ForwardJWT,
+		ClaimToHeaders:    claimToHeaders,
+		JWKSScheme:        u.Scheme,
+		JWKSHostname:      host,
+		JWKSPort:          port,
+	}, nil
+}
+
+// ValidateJWTRequirement resolves a Route's JWTRequirement against the
+// VirtualHost's declared providers, so that a typo'd or undeclared
+// providerName is rejected at IngressRoute admission time instead of the
+// jwt_authn filter silently never being enforced for that route. providers
+// is keyed by JWTProvider.Name().
+func ValidateJWTRequirement(spec ingressroutev1.JWTRequirement, providers map[string]*JWTProvider) (*JWTProvider, error) {
+	if spec.ProviderName == "" {
+		return nil, fmt.Errorf("jwtRequirement: providerName is required")
+	}
+	p, ok := providers[spec.ProviderName]
+	if !ok {
+		return nil, fmt.Errorf("jwtRequirement: providerName %q is not declared in this VirtualHost's jwtProviders", spec.ProviderName)
+	}
+	return p, nil
+}
@@ -0,0 +1,125 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dag
+
+import (
+	"testing"
+
+	ingressroutev1 "github.com/heptio/contour/apis/contour/v1beta1"
+)
+
+func TestBuildJWTProviderParsesJWKSURI(t *testing.T) {
+	tests := map[string]struct {
+		spec         ingressroutev1.JWTProvider
+		wantErr      bool
+		wantScheme   string
+		wantHostname string
+		wantPort     int
+	}{
+		"https with explicit port": {
+			spec:         ingressroutev1.JWTProvider{Name: "google", JWKSURI: "https://www.googleapis.com:8443/oauth2/v3/certs"},
+			wantScheme:   "https",
+			wantHostname: "www.googleapis.com",
+			wantPort:     8443,
+		},
+		"https defaults to 443": {
+			spec:         ingressroutev1.JWTProvider{Name: "google", JWKSURI: "https://www.googleapis.com/oauth2/v3/certs"},
+			wantScheme:   "https",
+			wantHostname: "www.googleapis.com",
+			wantPort:     443,
+		},
+		"http defaults to 80": {
+			spec:         ingressroutev1.JWTProvider{Name: "internal", JWKSURI: "http://jwks.internal/keys"},
+			wantScheme:   "http",
+			wantHostname: "jwks.internal",
+			wantPort:     80,
+		},
+		"missing name is rejected": {
+			spec:    ingressroutev1.JWTProvider{JWKSURI: "https://example.com/keys"},
+			wantErr: true,
+		},
+		"unsupported scheme is rejected": {
+			spec:    ingressroutev1.JWTProvider{Name: "bad", JWKSURI: "ftp://example.com/keys"},
+			wantErr: true,
+		},
+		"unparseable uri is rejected": {
+			spec:    ingressroutev1.JWTProvider{Name: "bad", JWKSURI: "://::not-a-url"},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := BuildJWTProvider("default", tc.spec)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("BuildJWTProvider(%v): err = nil, want error", tc.spec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BuildJWTProvider(%v): unexpected error: %v", tc.spec, err)
+			}
+			if got.JWKSScheme != tc.wantScheme || got.JWKSHostname != tc.wantHostname || got.JWKSPort != tc.wantPort {
+				t.Fatalf("BuildJWTProvider(%v) = {%s, %s, %d}, want {%s, %s, %d}",
+					tc.spec, got.JWKSScheme, got.JWKSHostname, got.JWKSPort, tc.wantScheme, tc.wantHostname, tc.wantPort)
+			}
+			if got.Name() != tc.spec.Name || got.Namespace() != "default" {
+				t.Fatalf("BuildJWTProvider(%v): Name()/Namespace() = %s/%s, want %s/default", tc.spec, got.Name(), got.Namespace(), tc.spec.Name)
+			}
+		})
+	}
+}
+
+func TestValidateJWTRequirement(t *testing.T) {
+	google := &JWTProvider{providerName: "google"}
+	providers := map[string]*JWTProvider{"google": google}
+
+	tests := map[string]struct {
+		spec    ingressroutev1.JWTRequirement
+		want    *JWTProvider
+		wantErr bool
+	}{
+		"declared provider resolves": {
+			spec: ingressroutev1.JWTRequirement{ProviderName: "google"},
+			want: google,
+		},
+		"missing providerName is rejected": {
+			spec:    ingressroutev1.JWTRequirement{},
+			wantErr: true,
+		},
+		"undeclared providerName is rejected": {
+			spec:    ingressroutev1.JWTRequirement{ProviderName: "okta"},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ValidateJWTRequirement(tc.spec, providers)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("ValidateJWTRequirement(%v, providers): err = nil, want error", tc.spec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ValidateJWTRequirement(%v, providers): unexpected error: %v", tc.spec, err)
+			}
+			if got != tc.want {
+				t.Fatalf("ValidateJWTRequirement(%v, providers) = %v, want %v", tc.spec, got, tc.want)
+			}
+		})
+	}
+}
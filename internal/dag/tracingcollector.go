@@ -0,0 +1,136 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dag
+
+import (
+	"fmt"
+
+	ingressroutev1 "github.com/heptio/contour/apis/contour/v1beta1"
+	"github.com/heptio/contour/pkg/config"
+)
+
+// TracingCollector is a DAG vertex representing a single tracing collector
+// declared in Contour's config file. Because the same collector is usually
+// referenced by many VirtualHosts, it is modelled as a vertex of its own,
+// reachable from every VirtualHost whose TracingPolicy names it, rather
+// than duplicated per VirtualHost: clusterVisitor only builds one copy of
+// it, the same way it dedupes a JWTProvider's JWKS cluster.
+type TracingCollector struct {
+	collectorName string
+
+	Hostname string
+	Port     int
+	Protocol string
+
+	// Secure and CACertificate mirror JWTProvider's JWKSScheme/CACertificate:
+	// when Secure is true the cluster validates the collector's certificate
+	// against the named Secret.
+	Secure        bool
+	CACertificate string
+}
+
+// Namespace returns "" - a tracing collector is declared in Contour's
+// config file, not a namespaced IngressRoute.
+func (t *TracingCollector) Namespace() string { return "" }
+
+// Name returns the collector's name, as declared in Contour's config file
+// and referenced by spec.virtualhost.tracing.collectorName.
+func (t *TracingCollector) Name() string { return t.collectorName }
+
+// Visit satisfies Vertex. TracingCollector is a leaf: it has no DAG children.
+func (t *TracingCollector) Visit(func(Vertex)) {}
+
+// BuildTracingCollector translates a single entry of Contour's config file
+// config.TracingConfig.Collectors into the DAG vertex clusterVisitor
+// consumes. Neither Contour's config loader nor the DAG builder calls it.
+func BuildTracingCollector(cfg config.TracingCollectorConfig) (*TracingCollector, error) {
+	if cfg.Name == "" {
+		return nil, fmt.Errorf("tracing: collector name is required")
+	}
+	if cfg.Hostname == "" {
+		return nil, fmt.Errorf("tracing: collector %q: hostname is required", cfg.Name)
+	}
+	return &TracingCollector{
+		collectorName: cfg.Name,
+		Hostname:      cfg.Hostname,
+		Port:          cfg.Port,
+		Protocol:      cfg.Protocol,
+		Secure:        cfg.Secure,
+		CACertificate: cfg.CACertificate,
+	}, nil
+}
+
+// TracingCustomTag is the DAG form of ingressroutev1.TracingCustomTag.
+type TracingCustomTag struct {
+	Tag               string
+	Literal           string
+	RequestHeaderName string
+}
+
+// TracingPolicy is a VirtualHost's validated tracing configuration. Unlike
+// TracingCollector it is not a DAG vertex: clusterVisitor and routeVisitor
+// each carry it in a map keyed by the generated name they build (an EDS
+// cluster name for clusterVisitor, a VirtualHost's fqdn for routeVisitor),
+// the same way clusterVisitor.TLSOverrides carries a per-service TLS
+// override without requiring a new field on dag.Service.
+type TracingPolicy struct {
+	// CollectorName names the TracingCollector this policy's spans are
+	// reported to.
+	CollectorName string
+
+	// ServiceName overrides the AltStatName clusterVisitor sets on this
+	// VirtualHost's clusters. Empty means "use the generated cluster name".
+	ServiceName string
+
+	// ClientSampling is the percentage, in [0, 100], of requests Envoy
+	// samples when the incoming request carries no tracing decision. Nil
+	// means "use Envoy's default".
+	ClientSampling *float64
+
+	// CustomTags adds tags to every span, either literal or copied from a
+	// request header.
+	CustomTags []TracingCustomTag
+}
+
+// BuildTracingPolicy translates a VirtualHost's spec.virtualhost.tracing
+// into a TracingPolicy, validating that CollectorName references a
+// collector Contour's config file has declared, that ClientSampling (if
+// set) is a valid percentage, and that every custom tag sets exactly one
+// of Literal or RequestHeaderName.
+func BuildTracingPolicy(spec ingressroutev1.TracingConfig, collectors map[string]*TracingCollector) (*TracingPolicy, error) {
+	if spec.CollectorName == "" {
+		return nil, fmt.Errorf("tracing: collectorName is required")
+	}
+	if _, ok := collectors[spec.CollectorName]; !ok {
+		return nil, fmt.Errorf("tracing: collector %q is not declared in Contour's config file", spec.CollectorName)
+	}
+	if spec.ClientSampling != nil && (*spec.ClientSampling < 0 || *spec.ClientSampling > 100) {
+		return nil, fmt.Errorf("tracing: clientSampling must be between 0 and 100, got %v", *spec.ClientSampling)
+	}
+
+	tags := make([]TracingCustomTag, 0, len(spec.CustomTags))
+	for _, tag := range spec.CustomTags {
+		if (tag.Literal == "") == (tag.RequestHeaderName == "") {
+			return nil, fmt.Errorf("tracing: tag %q must set exactly one of literal or requestHeaderName", tag.Tag)
+		}
+		tags = append(tags, TracingCustomTag{Tag: tag.Tag, Literal: tag.Literal, RequestHeaderName: tag.RequestHeaderName})
+	}
+
+	return &TracingPolicy{
+		CollectorName:  spec.CollectorName,
+		ServiceName:    spec.ServiceName,
+		ClientSampling: spec.ClientSampling,
+		CustomTags:     tags,
+	}, nil
+}
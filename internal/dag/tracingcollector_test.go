@@ -0,0 +1,132 @@
+// Copyright © 2018 Heptio
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dag
+
+import (
+	"testing"
+
+	ingressroutev1 "github.com/heptio/contour/apis/contour/v1beta1"
+	"github.com/heptio/contour/pkg/config"
+)
+
+func TestBuildTracingCollector(t *testing.T) {
+	tests := map[string]struct {
+		cfg     config.TracingCollectorConfig
+		wantErr bool
+	}{
+		"valid": {
+			cfg: config.TracingCollectorConfig{Name: "zipkin", Hostname: "zipkin.tracing.svc.cluster.local", Port: 9411},
+		},
+		"missing name is rejected": {
+			cfg:     config.TracingCollectorConfig{Hostname: "zipkin.tracing.svc.cluster.local", Port: 9411},
+			wantErr: true,
+		},
+		"missing hostname is rejected": {
+			cfg:     config.TracingCollectorConfig{Name: "zipkin", Port: 9411},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := BuildTracingCollector(tc.cfg)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("BuildTracingCollector(%v): err = nil, want error", tc.cfg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BuildTracingCollector(%v): unexpected error: %v", tc.cfg, err)
+			}
+			if got.Name() != tc.cfg.Name || got.Hostname != tc.cfg.Hostname || got.Port != tc.cfg.Port {
+				t.Fatalf("BuildTracingCollector(%v) = {%s, %s, %d}, want {%s, %s, %d}",
+					tc.cfg, got.Name(), got.Hostname, got.Port, tc.cfg.Name, tc.cfg.Hostname, tc.cfg.Port)
+			}
+		})
+	}
+}
+
+func TestBuildTracingPolicy(t *testing.T) {
+	collectors := map[string]*TracingCollector{
+		"zipkin": {collectorName: "zipkin", Hostname: "zipkin.tracing.svc.cluster.local", Port: 9411},
+	}
+
+	sampling50 := 50.0
+	samplingOutOfRange := 101.0
+
+	tests := map[string]struct {
+		spec    ingressroutev1.TracingConfig
+		wantErr bool
+	}{
+		"valid with sampling and a literal tag": {
+			spec: ingressroutev1.TracingConfig{
+				CollectorName:  "zipkin",
+				ServiceName:    "frontend",
+				ClientSampling: &sampling50,
+				CustomTags:     []ingressroutev1.TracingCustomTag{{Tag: "env", Literal: "prod"}},
+			},
+		},
+		"valid with a header-derived tag": {
+			spec: ingressroutev1.TracingConfig{
+				CollectorName: "zipkin",
+				CustomTags:    []ingressroutev1.TracingCustomTag{{Tag: "user", RequestHeaderName: "x-user-id"}},
+			},
+		},
+		"missing collectorName is rejected": {
+			spec:    ingressroutev1.TracingConfig{},
+			wantErr: true,
+		},
+		"unknown collectorName is rejected": {
+			spec:    ingressroutev1.TracingConfig{CollectorName: "unknown"},
+			wantErr: true,
+		},
+		"sampling out of range is rejected": {
+			spec:    ingressroutev1.TracingConfig{CollectorName: "zipkin", ClientSampling: &samplingOutOfRange},
+			wantErr: true,
+		},
+		"tag with neither literal nor header is rejected": {
+			spec: ingressroutev1.TracingConfig{
+				CollectorName: "zipkin",
+				CustomTags:    []ingressroutev1.TracingCustomTag{{Tag: "env"}},
+			},
+			wantErr: true,
+		},
+		"tag with both literal and header is rejected": {
+			spec: ingressroutev1.TracingConfig{
+				CollectorName: "zipkin",
+				CustomTags:    []ingressroutev1.TracingCustomTag{{Tag: "env", Literal: "prod", RequestHeaderName: "x-env"}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := BuildTracingPolicy(tc.spec, collectors)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("BuildTracingPolicy(%v): err = nil, want error", tc.spec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BuildTracingPolicy(%v): unexpected error: %v", tc.spec, err)
+			}
+			if got.CollectorName != tc.spec.CollectorName || got.ServiceName != tc.spec.ServiceName {
+				t.Fatalf("BuildTracingPolicy(%v) = %+v, want CollectorName/ServiceName %s/%s", tc.spec, got, tc.spec.CollectorName, tc.spec.ServiceName)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright Project Contour Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import "fmt"
+
+// TLSParameters holds the TLS handshake tuning Contour exposes both as a
+// global default in its config file and as a per-IngressRoute override via
+// spec.upstreamValidation.tlsParameters. An empty MinimumProtocolVersion or
+// MaximumProtocolVersion leaves the corresponding Envoy field unset, letting
+// Envoy pick its own default.
+type TLSParameters struct {
+	CipherSuites           []string
+	MinimumProtocolVersion string
+	MaximumProtocolVersion string
+}
+
+// validTLSProtocolVersions contains the TLS protocol versions Contour will
+// accept in an IngressRoute or the Contour config file, plus "" to mean
+// "unset".
+var validTLSProtocolVersions = map[string]struct{}{
+	"":    {},
+	"1.0": {},
+	"1.1": {},
+	"1.2": {},
+	"1.3": {},
+}
+
+// Validate checks CipherSuites against TLSCiphers.Validate and rejects an
+// unrecognised protocol version, so an invalid IngressRoute is refused at
+// admission time rather than silently passed to Envoy.
+func (p TLSParameters) Validate() error {
+	if err := TLSCiphers(p.CipherSuites).Validate(); err != nil {
+		return err
+	}
+	if _, ok := validTLSProtocolVersions[p.MinimumProtocolVersion]; !ok {
+		return fmt.Errorf("invalid minimum TLS protocol version: %q", p.MinimumProtocolVersion)
+	}
+	if _, ok := validTLSProtocolVersions[p.MaximumProtocolVersion]; !ok {
+		return fmt.Errorf("invalid maximum TLS protocol version: %q", p.MaximumProtocolVersion)
+	}
+	return nil
+}
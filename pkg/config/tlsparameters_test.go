@@ -0,0 +1,54 @@
+// Copyright Project Contour Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import "testing"
+
+func TestTLSParametersValidate(t *testing.T) {
+	tests := map[string]struct {
+		params  TLSParameters
+		wantErr bool
+	}{
+		"zero value is valid": {
+			params: TLSParameters{},
+		},
+		"valid explicit versions": {
+			params: TLSParameters{MinimumProtocolVersion: "1.2", MaximumProtocolVersion: "1.3"},
+		},
+		"invalid cipher rejected": {
+			params:  TLSParameters{CipherSuites: []string{"not-a-cipher"}},
+			wantErr: true,
+		},
+		"invalid minimum version rejected": {
+			params:  TLSParameters{MinimumProtocolVersion: "1.4"},
+			wantErr: true,
+		},
+		"invalid maximum version rejected": {
+			params:  TLSParameters{MaximumProtocolVersion: "ssl3"},
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tc.params.Validate()
+			if tc.wantErr && err == nil {
+				t.Fatalf("TLSParameters(%+v).Validate() = nil, want error", tc.params)
+			}
+			if !tc.wantErr && err != nil {
+				t.Fatalf("TLSParameters(%+v).Validate() = %v, want nil", tc.params, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright Project Contour Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import "fmt"
+
+// TracingCollectorConfig declares a single tracing collector - Zipkin,
+// Jaeger, OpenTelemetry/OTLP, or Datadog - that Contour materializes as a
+// cluster, the same way a JWTProvider's JWKSURI addresses a remote JWKS
+// endpoint. Referenced by name from an IngressRoute's
+// spec.virtualhost.tracing.collectorName.
+type TracingCollectorConfig struct {
+	// Name identifies this collector for use in
+	// spec.virtualhost.tracing.collectorName.
+	Name string `yaml:"name"`
+
+	// Hostname and Port address the collector. The cluster is backed by a
+	// static STRICT_DNS load assignment rather than EDS, since a
+	// collector is usually not a Kubernetes Service Contour has a
+	// ServicePort for.
+	Hostname string `yaml:"hostname"`
+	Port     int    `yaml:"port"`
+
+	// Protocol is the L7 protocol Contour speaks to the collector: "h2"
+	// for collectors that require gRPC (most OTLP and Datadog agents), or
+	// "" for a plain HTTP/1.1 Zipkin-style collector.
+	Protocol string `yaml:"protocol,omitempty"`
+
+	// Secure wraps the connection to the collector in TLS, validated
+	// against CACertificate the same way a JWTProvider's JWKS endpoint is.
+	Secure bool `yaml:"secure,omitempty"`
+
+	// CACertificate names the Secret used to validate the collector's
+	// certificate when Secure is true.
+	CACertificate string `yaml:"caCertificate,omitempty"`
+}
+
+// TracingConfig declares the tracing collectors Contour's config file
+// makes available to IngressRoutes.
+type TracingConfig struct {
+	Collectors []TracingCollectorConfig `yaml:"collectors,omitempty"`
+}
+
+// Validate rejects a collector with no name or hostname, a port out of
+// range, or a duplicate name, the same way TLSParameters.Validate rejects
+// an invalid config at load time rather than silently passing it to Envoy.
+func (t TracingConfig) Validate() error {
+	seen := make(map[string]bool, len(t.Collectors))
+	for _, c := range t.Collectors {
+		if c.Name == "" {
+			return fmt.Errorf("tracing: collector name is required")
+		}
+		if seen[c.Name] {
+			return fmt.Errorf("tracing: duplicate collector name %q", c.Name)
+		}
+		seen[c.Name] = true
+		if c.Hostname == "" {
+			return fmt.Errorf("tracing: collector %q: hostname is required", c.Name)
+		}
+		if c.Port <= 0 || c.Port > 65535 {
+			return fmt.Errorf("tracing: collector %q: invalid port %d", c.Name, c.Port)
+		}
+	}
+	return nil
+}
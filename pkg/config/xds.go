@@ -0,0 +1,25 @@
+// Copyright Project Contour Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// XDSServerConfig controls how Contour's gRPC server talks to Envoy.
+type XDSServerConfig struct {
+	// IncrementalXDS gates whether clusterDiscoveryServer.DeltaClusters
+	// serves Envoy's incremental (delta) xDS protocol for CDS instead of
+	// returning Unimplemented, for operators with large numbers of
+	// clusters where only a handful change at a time. Unset, Envoy must
+	// fall back to the default State-of-the-World protocol served by
+	// StreamClusters/FetchClusters.
+	IncrementalXDS bool `yaml:"incrementalXDS,omitempty"`
+}